@@ -1,10 +1,36 @@
 package collector
 
-import tele "gopkg.in/telebot.v4"
+import (
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// batchDeleteCutoff is how far back Telegram's batch delete endpoint reaches; messages
+// older than this must be deleted one by one.
+const batchDeleteCutoff = 48 * time.Hour
+
+// batchDeleteLimit is the maximum number of message IDs Telegram accepts per deleteMessages call
+const batchDeleteLimit = 100
+
+// msgKey identifies a message across chats, since message IDs are only unique per chat
+type msgKey struct {
+	chatID int64
+	msgID  int
+}
+
+func keyOf(m *tele.Message) msgKey {
+	return msgKey{chatID: m.Chat.ID, msgID: m.ID}
+}
 
 // MessageCollector is a collector for messages, it may be used to storage messages and delete them all afterward
 type MessageCollector struct {
+	mu       sync.Mutex
 	messages []*tele.Message
+	timers   map[msgKey]*time.Timer
+
+	ttl time.Duration
 }
 
 func New() *MessageCollector {
@@ -13,11 +39,28 @@ func New() *MessageCollector {
 	}
 }
 
+// NewWithTTL creates a MessageCollector where every message collected through Send is
+// automatically deleted after d unless Clear or Stop runs first
+func NewWithTTL(d time.Duration) *MessageCollector {
+	mc := New()
+	mc.ttl = d
+	return mc
+}
+
 // Collect adds message to the collector
 func (mc *MessageCollector) Collect(m *tele.Message) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
 	mc.messages = append(mc.messages, m)
 }
 
+// CollectWithTTL adds message to the collector and schedules it for automatic deletion
+// after d, regardless of the collector's default TTL
+func (mc *MessageCollector) CollectWithTTL(c tele.Context, m *tele.Message, d time.Duration) {
+	mc.Collect(m)
+	mc.scheduleTTL(c.Bot(), m, d)
+}
+
 // Send sends message to the context chat and collects it
 func (mc *MessageCollector) Send(c tele.Context, what interface{}, opts ...interface{}) error {
 	message, errSend := c.Bot().Send(c.Chat(), what, opts...)
@@ -25,15 +68,75 @@ func (mc *MessageCollector) Send(c tele.Context, what interface{}, opts ...inter
 		return errSend
 	}
 
-	mc.Collect(message)
+	if mc.ttl > 0 {
+		mc.CollectWithTTL(c, message, mc.ttl)
+	} else {
+		mc.Collect(message)
+	}
 	return nil
 }
 
 // GetMessages returns collected messages
 func (mc *MessageCollector) GetMessages() []*tele.Message {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
 	return mc.messages
 }
 
+// Stop cancels every pending TTL timer without deleting the messages they were attached to
+func (mc *MessageCollector) Stop() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	for key, timer := range mc.timers {
+		timer.Stop()
+		delete(mc.timers, key)
+	}
+}
+
+// scheduleTTL deletes m once d elapses, unless it's canceled first by Stop or Clear
+func (mc *MessageCollector) scheduleTTL(bot *tele.Bot, m *tele.Message, d time.Duration) {
+	key := keyOf(m)
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if mc.timers == nil {
+		mc.timers = make(map[msgKey]*time.Timer)
+	}
+	mc.timers[key] = time.AfterFunc(d, func() {
+		_ = bot.Delete(m)
+		mc.forget(key)
+	})
+}
+
+// forget removes m's timer and tracked entry, e.g. once its TTL has fired
+func (mc *MessageCollector) forget(key msgKey) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	delete(mc.timers, key)
+	for i, message := range mc.messages {
+		if keyOf(message) == key {
+			mc.messages = append(mc.messages[:i], mc.messages[i+1:]...)
+			return
+		}
+	}
+}
+
+// cancelTimers stops and forgets the TTL timer for each of messages, if any, so Clear never
+// races a timer into double-deleting (and swallowing an error on) a message it just deleted
+func (mc *MessageCollector) cancelTimers(messages []*tele.Message) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	for _, m := range messages {
+		key := keyOf(m)
+		if timer, ok := mc.timers[key]; ok {
+			timer.Stop()
+			delete(mc.timers, key)
+		}
+	}
+}
+
 type ClearOptions struct {
 	// IgnoreErrors will ignore all errors that occurred during deletion
 	IgnoreErrors bool
@@ -43,18 +146,58 @@ type ClearOptions struct {
 
 // Clear deletes all collected messages and cleans the collector
 //
+// Messages younger than 48 hours are deleted in batches via the Bot API's deleteMessages
+// method (up to 100 IDs per chat per call); older ones (which Telegram won't batch-delete)
+// fall back to one Delete call each.
+//
 // If ignoreErrors is true, it will ignore all errors that occurred during deletion
 func (mc *MessageCollector) Clear(c tele.Context, opts ClearOptions) error {
-	for i, message := range mc.messages {
-		if opts.ExcludeLast && i == len(mc.messages)-1 {
+	mc.mu.Lock()
+	messages := mc.messages
+	mc.messages = make([]*tele.Message, 0)
+	mc.mu.Unlock()
+
+	if opts.ExcludeLast && len(messages) > 0 {
+		messages = messages[:len(messages)-1]
+	}
+
+	// Stop any pending TTL timers for the messages we're about to delete ourselves, so they
+	// don't later fire and call Delete again on a message that's already gone.
+	mc.cancelTimers(messages)
+
+	byChat := make(map[int64][]int)
+	var stale []*tele.Message
+	cutoff := time.Now().Add(-batchDeleteCutoff)
+	for _, message := range messages {
+		if message.Time().Before(cutoff) {
+			stale = append(stale, message)
 			continue
 		}
-		err := c.Bot().Delete(message)
-		if err != nil && !opts.IgnoreErrors {
+		byChat[message.Chat.ID] = append(byChat[message.Chat.ID], message.ID)
+	}
+
+	for chatID, ids := range byChat {
+		for len(ids) > 0 {
+			n := batchDeleteLimit
+			if n > len(ids) {
+				n = len(ids)
+			}
+			_, err := c.Bot().Raw("deleteMessages", map[string]interface{}{
+				"chat_id":     chatID,
+				"message_ids": ids[:n],
+			})
+			if err != nil && !opts.IgnoreErrors {
+				return err
+			}
+			ids = ids[n:]
+		}
+	}
+
+	for _, message := range stale {
+		if err := c.Bot().Delete(message); err != nil && !opts.IgnoreErrors {
 			return err
 		}
 	}
 
-	mc.messages = make([]*tele.Message, 0)
 	return nil
 }
@@ -0,0 +1,37 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// TestCancelTimersRemovesScheduledTTL is a regression test for Clear deleting messages without
+// canceling their per-message TTL timers, which would otherwise fire later and try to delete an
+// already-deleted message.
+func TestCancelTimersRemovesScheduledTTL(t *testing.T) {
+	mc := New()
+	bot := &tele.Bot{}
+
+	m := &tele.Message{ID: 1, Chat: &tele.Chat{ID: 100}}
+	mc.Collect(m)
+	mc.scheduleTTL(bot, m, time.Hour) // long enough that it can't fire during this test
+
+	key := keyOf(m)
+	mc.mu.Lock()
+	_, scheduled := mc.timers[key]
+	mc.mu.Unlock()
+	if !scheduled {
+		t.Fatalf("expected a TTL timer to be scheduled for the collected message")
+	}
+
+	mc.cancelTimers([]*tele.Message{m})
+
+	mc.mu.Lock()
+	_, stillScheduled := mc.timers[key]
+	mc.mu.Unlock()
+	if stillScheduled {
+		t.Fatalf("expected the message's TTL timer to be canceled and removed")
+	}
+}
@@ -2,10 +2,12 @@ package intele
 
 import (
 	"context"
+	"fmt"
 	"github.com/nlypage/intele/storage"
 	"strings"
 
 	"sync"
+	"sync/atomic"
 	"time"
 
 	tele "gopkg.in/telebot.v3"
@@ -13,28 +15,97 @@ import (
 
 const (
 	stateWaitingInput = "waiting_input"
+
+	// storageCheckInterval is how often Get re-checks the storage state while waiting,
+	// so that expiration/deletion at the storage layer (e.g. a RedisStorage key expiring,
+	// or state being lost across a restart) reliably unblocks the waiter.
+	storageCheckInterval = time.Second
 )
 
+// requestSeq hands out a unique suffix for each pendingRequest's stored state value, so
+// that two successive requests for the same userID (e.g. ReplaceExisting canceling a stale
+// one) never share a state value and can tell their own storage entry apart from a newer one.
+var requestSeq atomic.Int64
+
 // pendingRequest represents a pending input request from a user
 type pendingRequest struct {
-	mu        sync.Mutex
-	message   *tele.Message // the response message
-	callback  *tele.Callback
-	completed bool // whether the request has been completed
-	canceled  bool // whether the request has been canceled (completed will be true in this case)
+	once      sync.Once
+	done      chan struct{} // closed once a response has been delivered
+	response  Response
 	callbacks []tele.CallbackEndpoint
+	startedAt time.Time
+	state     string // this request's own value for storage.Set, unique per request
+}
+
+// newPendingRequest creates a pending request waiting on the given callback endpoints
+func newPendingRequest(callbacks []tele.CallbackEndpoint) *pendingRequest {
+	return &pendingRequest{
+		done:      make(chan struct{}),
+		callbacks: callbacks,
+		startedAt: time.Now(),
+		state:     fmt.Sprintf("%s:%d", stateWaitingInput, requestSeq.Add(1)),
+	}
+}
+
+// complete delivers resp to the waiting Get call, if it hasn't been delivered already
+func (r *pendingRequest) complete(resp Response) {
+	r.once.Do(func() {
+		r.response = resp
+		close(r.done)
+	})
 }
 
 // InputManager is a manager for input requests
 type InputManager struct {
 	storage  storage.StateStorage
 	requests sync.Map
+
+	maxConcurrentRequests int
+	maxPerUser            int
+	replaceExisting       bool
+
+	// admitMu guards concurrentRequests and perUserRequests, which otherwise only have
+	// check-then-act semantics as individual atomics: two concurrent Get calls could each
+	// observe the limit as not-yet-reached and both proceed. Admission (the check, the
+	// increment, and an over-limit Cancel) and release (the decrement and map cleanup) all
+	// happen while holding admitMu, making the whole sequence atomic per call.
+	admitMu            sync.Mutex
+	concurrentRequests int64
+	perUserRequests    map[int64]*int64 // userID -> in-flight count
+
+	sink MetricsSink // optional, set via SetMetricsSink
+}
+
+// MetricsSink receives events from an InputManager as they happen. The metrics subpackage
+// implements this to expose them as Prometheus metrics; it's exported so other collectors
+// can be attached the same way without this package depending on any metrics library.
+type MetricsSink interface {
+	ObserveWait(d time.Duration)
+	IncTimeout()
+	IncCancel()
+}
+
+// SetMetricsSink attaches sink so that Get/Cancel report into it as they happen, e.g.
+// im.SetMetricsSink(metrics.New(im)). Passing nil detaches the current sink.
+func (h *InputManager) SetMetricsSink(sink MetricsSink) {
+	h.sink = sink
 }
 
 // InputOptions contains options for the input manager
 type InputOptions struct {
 	// Storage for storing user states (default: in memory)
 	Storage storage.StateStorage
+
+	// MaxConcurrentRequests limits the total number of in-flight Get calls across all users.
+	// 0 means unlimited (default).
+	MaxConcurrentRequests int
+
+	// MaxPerUser limits the number of in-flight Get calls for a single user (default: 1).
+	MaxPerUser int
+
+	// ReplaceExisting, when true, cancels a user's existing pending request (via Cancel) instead
+	// of returning ErrTooManyConcurrent once MaxPerUser is reached for that user
+	ReplaceExisting bool
 }
 
 // NewInputManager creates a new input manager
@@ -45,8 +116,68 @@ func NewInputManager(opts InputOptions) *InputManager {
 	if opts.Storage == nil {
 		opts.Storage = storage.NewMemoryStorage()
 	}
+	if opts.MaxPerUser == 0 {
+		opts.MaxPerUser = 1
+	}
 	return &InputManager{
-		storage: opts.Storage,
+		storage:               opts.Storage,
+		maxConcurrentRequests: opts.MaxConcurrentRequests,
+		maxPerUser:            opts.MaxPerUser,
+		replaceExisting:       opts.ReplaceExisting,
+		perUserRequests:       make(map[int64]*int64),
+	}
+}
+
+// admit enforces MaxConcurrentRequests/MaxPerUser and reserves a slot for userID as one
+// atomic operation, canceling userID's existing request first if ReplaceExisting permits it.
+// Returns ErrTooManyConcurrent if no slot could be reserved.
+func (h *InputManager) admit(userID int64) error {
+	h.admitMu.Lock()
+	defer h.admitMu.Unlock()
+
+	if h.maxConcurrentRequests > 0 && h.concurrentRequests >= int64(h.maxConcurrentRequests) {
+		return ErrTooManyConcurrent
+	}
+
+	count, ok := h.perUserRequests[userID]
+	if !ok {
+		count = new(int64)
+		h.perUserRequests[userID] = count
+	}
+	if h.maxPerUser > 0 && *count >= int64(h.maxPerUser) {
+		if !h.replaceExisting {
+			return ErrTooManyConcurrent
+		}
+		// Cancel only signals the old request's done channel and doesn't take admitMu; the old
+		// Get call's deferred release does take admitMu, but in its own goroutine, so it just
+		// waits until this admit returns. Calling Cancel while holding the lock can't deadlock.
+		h.Cancel(userID)
+	}
+
+	*count++
+	h.concurrentRequests++
+	return nil
+}
+
+// release undoes a prior successful admit for userID
+func (h *InputManager) release(userID int64) {
+	h.admitMu.Lock()
+	defer h.admitMu.Unlock()
+
+	h.concurrentRequests--
+	if count, ok := h.perUserRequests[userID]; ok {
+		*count--
+		if *count == 0 {
+			delete(h.perUserRequests, userID)
+		}
+	}
+}
+
+// deleteStorage deletes userID's storage entry only if it still holds expected, so that a
+// request's own cleanup can never wipe out a newer request that has since replaced it
+func (h *InputManager) deleteStorage(userID int64, expected string) {
+	if current, err := h.storage.Get(userID); err == nil && current == expected {
+		h.storage.Delete(userID)
 	}
 }
 
@@ -63,22 +194,19 @@ func (h *InputManager) MessageHandler() tele.HandlerFunc {
 
 		// Check if we're waiting for input from this user
 		state, err := h.storage.Get(userID)
-		if err != nil || state != stateWaitingInput {
+		if err != nil || !strings.HasPrefix(state, stateWaitingInput) {
 			return nil
 		}
 
 		// Get or create pending request
-		value, _ := h.requests.LoadOrStore(userID, &pendingRequest{})
+		value, _ := h.requests.LoadOrStore(userID, newPendingRequest(nil))
 		req := value.(*pendingRequest)
 
-		// Set response and mark as completed
-		req.mu.Lock()
-		req.message = c.Message()
-		req.completed = true
-		req.mu.Unlock()
+		// Deliver the response
+		req.complete(Response{Message: c.Message()})
 
-		// Clean up storage
-		h.storage.Delete(userID)
+		// Clean up storage, but only if it's still this request's own entry
+		h.deleteStorage(userID, req.state)
 
 		return nil
 	}
@@ -91,12 +219,12 @@ func (h *InputManager) CallbackHandler() tele.HandlerFunc {
 
 		// Check if we're waiting for input from this user
 		state, err := h.storage.Get(userID)
-		if err != nil || state != stateWaitingInput {
+		if err != nil || !strings.HasPrefix(state, stateWaitingInput) {
 			return nil
 		}
 
 		// Get or create pending request
-		value, _ := h.requests.LoadOrStore(userID, &pendingRequest{})
+		value, _ := h.requests.LoadOrStore(userID, newPendingRequest(nil))
 		req := value.(*pendingRequest)
 
 		// Check if callback is valid
@@ -111,15 +239,11 @@ func (h *InputManager) CallbackHandler() tele.HandlerFunc {
 
 			if strings.TrimSpace(cb.CallbackUnique()) == unique {
 				_ = c.Respond(&tele.CallbackResponse{})
-				// Set callback and mark as completed
-				req.mu.Lock()
-				req.callback = c.Callback()
-				req.message = c.Message()
-				req.completed = true
-				req.mu.Unlock()
+				// Deliver the response
+				req.complete(Response{Callback: c.Callback(), Message: c.Message()})
 
-				// Clean up storage
-				h.storage.Delete(userID)
+				// Clean up storage, but only if it's still this request's own entry
+				h.deleteStorage(userID, req.state)
 
 				return nil
 			}
@@ -130,6 +254,10 @@ func (h *InputManager) CallbackHandler() tele.HandlerFunc {
 }
 
 // Cancel cancels the input request for the given user
+//
+// NOTE: the actual requests/storage entries are removed by the canceled Get call's own
+// deferred cleanup (keyed by request identity), not here, so that canceling a stale request
+// can never race with and wipe out a newer one that has already replaced it
 func (h *InputManager) Cancel(userID int64) {
 	value, ok := h.requests.Load(userID)
 	if !ok {
@@ -137,13 +265,51 @@ func (h *InputManager) Cancel(userID int64) {
 	}
 
 	req := value.(*pendingRequest)
-	req.mu.Lock()
-	req.canceled = true
-	req.completed = true
-	req.mu.Unlock()
+	req.complete(Response{Canceled: true})
+
+	if h.sink != nil {
+		h.sink.IncCancel()
+	}
+}
+
+// Stats is a snapshot of InputManager's currently pending input requests
+type Stats struct {
+	// PendingRequests is the total number of in-flight Get calls across all users
+	PendingRequests int
+	// PerUser maps each user ID with in-flight requests to how many it has
+	PerUser map[int64]int
+	// OldestWaitSeconds is how long the longest-waiting pending request has been in flight
+	OldestWaitSeconds float64
+}
+
+// Stats returns a snapshot of currently pending input requests. Useful for monitoring how
+// many users are stuck waiting, spotting leaked pendingRequest entries, and alerting on
+// unusually high wait times without instrumenting every Get call site.
+func (h *InputManager) Stats() Stats {
+	stats := Stats{PerUser: make(map[int64]int)}
 
-	h.storage.Delete(userID)
-	h.requests.Delete(userID)
+	h.admitMu.Lock()
+	stats.PendingRequests = int(h.concurrentRequests)
+	for userID, count := range h.perUserRequests {
+		stats.PerUser[userID] = int(*count)
+	}
+	h.admitMu.Unlock()
+
+	var oldest time.Time
+	h.requests.Range(func(_, value interface{}) bool {
+		req := value.(*pendingRequest)
+
+		if oldest.IsZero() || req.startedAt.Before(oldest) {
+			oldest = req.startedAt
+		}
+		return true
+	})
+
+	if !oldest.IsZero() {
+		stats.OldestWaitSeconds = time.Since(oldest).Seconds()
+	}
+
+	return stats
 }
 
 // Response represents either a text message or a callback response
@@ -164,51 +330,85 @@ type Response struct {
 //   - It will return nil error and Response.Canceled=true if input canceled by Cancel
 //   - For text messages, Message field will be set and Callback will be nil
 //   - For button callbacks, Message will be nil and Callback will contain the callback data
+//   - It will return ErrTooManyConcurrent if MaxConcurrentRequests or MaxPerUser is exceeded
+//     (unless ReplaceExisting is set, in which case the user's prior request is canceled instead)
 func (h *InputManager) Get(ctx context.Context, userID int64, timeout time.Duration, callback ...tele.CallbackEndpoint) (Response, error) {
-	// Create request
-	req := &pendingRequest{
-		callbacks: callback,
+	if err := h.admit(userID); err != nil {
+		return Response{}, err
 	}
+
+	start := time.Now()
+	defer func() {
+		h.release(userID)
+		if h.sink != nil {
+			h.sink.ObserveWait(time.Since(start))
+		}
+	}()
+
+	// Create request
+	req := newPendingRequest(callback)
 	h.requests.Store(userID, req)
 
 	// Set the state
-	if err := h.storage.Set(userID, stateWaitingInput, timeout); err != nil {
-		h.requests.Delete(userID)
+	if err := h.storage.Set(userID, req.state, timeout); err != nil {
+		h.requests.CompareAndDelete(userID, req)
 		return Response{}, err
 	}
 
-	// Clean up when we're done
+	// Clean up when we're done. Both deletes are conditional on this request still being the
+	// one stored for userID, so a ReplaceExisting caller that has since stored its own newer
+	// request (and its own storage entry) can never be wiped out by this one's cleanup.
 	defer func() {
-		h.storage.Delete(userID)
-		h.requests.Delete(userID)
+		h.deleteStorage(userID, req.state)
+		h.requests.CompareAndDelete(userID, req)
 	}()
 
-	// Wait for response with polling
-	start := time.Now()
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	// The storage itself is the authoritative source of truth for expiration (this matters
+	// for backends like RedisStorage, where the key can expire or disappear independently of
+	// this process, e.g. after a restart). Periodically confirm our state is still there so we
+	// don't leak this pendingRequest forever if that happens.
+	checkInterval := storageCheckInterval
+	if timeout > 0 && timeout < checkInterval {
+		checkInterval = timeout
+	}
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	// Wait for a response, the context to be done, or the timeout to fire
 	for {
 		select {
 		case <-ctx.Done():
-			return Response{Canceled: true}, ctx.Err()
-		default:
-			req.mu.Lock()
-			if req.completed {
-				canceled := req.canceled
-				response := Response{
-					Message:  req.message,
-					Callback: req.callback,
-					Canceled: canceled,
-				}
-				req.mu.Unlock()
-				return response, nil
+			return Response{}, ctx.Err()
+		case <-timeoutCh:
+			if h.sink != nil {
+				h.sink.IncTimeout()
+			}
+			return Response{}, ErrTimeout
+		case <-req.done:
+			return req.response, nil
+		case <-ticker.C:
+			// req.done may have raced us here: MessageHandler/CallbackHandler close it before
+			// deleting the storage entry, so a tick landing in between can otherwise win the
+			// select and discard a response the user actually sent. Give done priority.
+			select {
+			case <-req.done:
+				return req.response, nil
+			default:
 			}
-			req.mu.Unlock()
 
-			if timeout > 0 && time.Since(start) > timeout {
+			if state, err := h.storage.Get(userID); err != nil || !strings.HasPrefix(state, stateWaitingInput) {
+				if h.sink != nil {
+					h.sink.IncTimeout()
+				}
 				return Response{}, ErrTimeout
 			}
-
-			// Small sleep to prevent CPU spinning
-			time.Sleep(100 * time.Millisecond)
 		}
 	}
 }
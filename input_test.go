@@ -0,0 +1,160 @@
+package intele
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// fakeContext implements tele.Context for exercising MessageHandler/CallbackHandler directly,
+// without needing a live telebot.Bot. Embedding the (nil) interface satisfies the rest of the
+// interface; only the methods InputManager actually calls are overridden below.
+type fakeContext struct {
+	tele.Context
+	sender   *tele.User
+	message  *tele.Message
+	callback *tele.Callback
+}
+
+func (f fakeContext) Sender() *tele.User       { return f.sender }
+func (f fakeContext) Message() *tele.Message   { return f.message }
+func (f fakeContext) Callback() *tele.Callback { return f.callback }
+func (f fakeContext) Respond(...*tele.CallbackResponse) error { return nil }
+
+func TestGetDeliversMessage(t *testing.T) {
+	im := NewInputManager(InputOptions{})
+	userID := int64(42)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		c := fakeContext{sender: &tele.User{ID: userID}, message: &tele.Message{Text: "hi"}}
+		if err := im.MessageHandler()(c); err != nil {
+			t.Errorf("MessageHandler returned error: %v", err)
+		}
+	}()
+
+	resp, err := im.Get(context.Background(), userID, time.Second)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if resp.Message == nil || resp.Message.Text != "hi" {
+		t.Fatalf("expected the delivered message, got %+v", resp)
+	}
+}
+
+// TestReplaceExistingDoesNotLoseNewRequest is a regression test for the race where the
+// canceled request's deferred cleanup could delete the replacement request's requests/storage
+// entries instead of its own, stranding the new Get call until timeout.
+func TestReplaceExistingDoesNotLoseNewRequest(t *testing.T) {
+	im := NewInputManager(InputOptions{ReplaceExisting: true, MaxPerUser: 1})
+	userID := int64(7)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	oldDone := make(chan struct{})
+	go func() {
+		defer close(oldDone)
+		_, _ = im.Get(ctx, userID, 0)
+	}()
+	time.Sleep(20 * time.Millisecond) // let the old Get register itself
+
+	resultCh := make(chan Response, 1)
+	go func() {
+		resp, _ := im.Get(context.Background(), userID, time.Second)
+		resultCh <- resp
+	}()
+	time.Sleep(20 * time.Millisecond) // let the new Get cancel and replace the old one
+
+	c := fakeContext{sender: &tele.User{ID: userID}, message: &tele.Message{Text: "reply"}}
+	if err := im.MessageHandler()(c); err != nil {
+		t.Fatalf("MessageHandler returned error: %v", err)
+	}
+
+	select {
+	case resp := <-resultCh:
+		if resp.Message == nil || resp.Message.Text != "reply" {
+			t.Fatalf("expected the new request to receive the reply, got %+v", resp)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("new Get call never received the reply")
+	}
+	<-oldDone
+}
+
+// TestAdmitEnforcesLimitsUnderConcurrency is a regression test for the check-then-act race in
+// admit/release: hammer it from many goroutines and verify neither MaxConcurrentRequests nor
+// MaxPerUser is ever exceeded.
+func TestAdmitEnforcesLimitsUnderConcurrency(t *testing.T) {
+	const maxConcurrent = 3
+	const maxPerUser = 2
+	im := NewInputManager(InputOptions{MaxConcurrentRequests: maxConcurrent, MaxPerUser: maxPerUser})
+
+	var mu sync.Mutex
+	current := 0
+	peak := 0
+	perUser := make(map[int64]int)
+	peakPerUser := 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		userID := int64(i % 5)
+		go func(userID int64) {
+			defer wg.Done()
+			if err := im.admit(userID); err != nil {
+				return
+			}
+
+			mu.Lock()
+			current++
+			perUser[userID]++
+			if current > peak {
+				peak = current
+			}
+			if perUser[userID] > peakPerUser {
+				peakPerUser = perUser[userID]
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			current--
+			perUser[userID]--
+			mu.Unlock()
+			im.release(userID)
+		}(userID)
+	}
+	wg.Wait()
+
+	if peak > maxConcurrent {
+		t.Fatalf("MaxConcurrentRequests=%d violated: observed %d concurrently admitted", maxConcurrent, peak)
+	}
+	if peakPerUser > maxPerUser {
+		t.Fatalf("MaxPerUser=%d violated: observed %d concurrently admitted for one user", maxPerUser, peakPerUser)
+	}
+}
+
+func TestGetEnforcesMaxPerUserWithoutReplace(t *testing.T) {
+	im := NewInputManager(InputOptions{MaxPerUser: 1})
+	userID := int64(99)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		_, _ = im.Get(ctx, userID, 0)
+	}()
+	<-started
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := im.Get(context.Background(), userID, time.Millisecond); err != ErrTooManyConcurrent {
+		t.Fatalf("expected ErrTooManyConcurrent, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+// Package metrics exposes an intele.InputManager's runtime state as Prometheus metrics. It's
+// kept separate from the root package so that consumers who never import it don't transitively
+// pull in github.com/prometheus/client_golang.
+package metrics
+
+import (
+	"time"
+
+	"github.com/nlypage/intele"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics exposes an InputManager's runtime state as Prometheus metrics. Register it once
+// with your registry, e.g. prometheus.MustRegister(metrics.New(im)).
+type Metrics struct {
+	pending       prometheus.GaugeFunc
+	waitSeconds   prometheus.Histogram
+	timeouts      prometheus.Counter
+	cancellations prometheus.Counter
+}
+
+// New creates a Metrics collector for im and attaches it so that Get/Cancel report into it
+// as they happen
+func New(im *intele.InputManager) *Metrics {
+	m := &Metrics{
+		waitSeconds: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "intele_request_wait_seconds",
+			Help:    "Time spent waiting for a response to an input request",
+			Buckets: prometheus.DefBuckets,
+		}),
+		timeouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "intele_timeouts_total",
+			Help: "Total number of input requests that ended in ErrTimeout",
+		}),
+		cancellations: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "intele_cancellations_total",
+			Help: "Total number of input requests ended via Cancel",
+		}),
+	}
+	m.pending = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "intele_pending_requests",
+		Help: "Current number of in-flight input requests",
+	}, func() float64 {
+		return float64(im.Stats().PendingRequests)
+	})
+
+	im.SetMetricsSink(m)
+	return m
+}
+
+func (m *Metrics) ObserveWait(d time.Duration) { m.waitSeconds.Observe(d.Seconds()) }
+func (m *Metrics) IncTimeout()                 { m.timeouts.Inc() }
+func (m *Metrics) IncCancel()                  { m.cancellations.Inc() }
+
+// Describe implements prometheus.Collector
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.pending.Describe(ch)
+	m.waitSeconds.Describe(ch)
+	m.timeouts.Describe(ch)
+	m.cancellations.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.pending.Collect(ch)
+	m.waitSeconds.Collect(ch)
+	m.timeouts.Collect(ch)
+	m.cancellations.Collect(ch)
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStorage is a Redis-backed implementation of StateStorage. Unlike MemoryStorage,
+// state survives bot restarts and is shared across instances, and expiration is
+// enforced by Redis itself rather than an in-process timer.
+type RedisStorage struct {
+	client *redis.Client
+}
+
+// NewRedisStorage creates a new RedisStorage backed by the given Redis client
+func NewRedisStorage(client *redis.Client) *RedisStorage {
+	return &RedisStorage{
+		client: client,
+	}
+}
+
+// stateKey returns the namespaced Redis key for a user's state
+func stateKey(userID int64) string {
+	return fmt.Sprintf("intele:state:%d", userID)
+}
+
+// Set sets the state for a user. If expiration is non-zero, the key expires after it elapses.
+func (r *RedisStorage) Set(userID int64, state string, expiration time.Duration) error {
+	return r.client.Set(context.Background(), stateKey(userID), state, expiration).Err()
+}
+
+func (r *RedisStorage) Get(userID int64) (string, error) {
+	state, err := r.client.Get(context.Background(), stateKey(userID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return state, nil
+}
+
+func (r *RedisStorage) Delete(userID int64) {
+	r.client.Del(context.Background(), stateKey(userID))
+}
@@ -14,21 +14,43 @@ type StateStorage interface {
 
 // MemoryStorage is a simple in-memory implementation of StateStorage
 type MemoryStorage struct {
-	mu    sync.RWMutex
-	store map[int64]string
+	mu     sync.RWMutex
+	store  map[int64]string
+	timers map[int64]*time.Timer
 }
 
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		store: make(map[int64]string),
+		store:  make(map[int64]string),
+		timers: make(map[int64]*time.Timer),
 	}
 }
 
-// Set sets the state for a user (expiration is ignored)
-func (m *MemoryStorage) Set(userID int64, state string, _ time.Duration) error {
+// Set sets the state for a user. If expiration is non-zero, the state is automatically
+// deleted once it elapses.
+func (m *MemoryStorage) Set(userID int64, state string, expiration time.Duration) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+
+	m.stopTimer(userID)
 	m.store[userID] = state
+
+	if expiration > 0 {
+		m.timers[userID] = time.AfterFunc(expiration, func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			// timer.Stop() in stopTimer can lose the race against an already-fired callback
+			// queued to run (Stop returns false in that case), so a new Set for this userID
+			// may have already taken the lock and written its own value/timer by the time this
+			// runs. Only delete if the stored value is still the one this timer was set for (a
+			// newer Set of the very same value can't be told apart and is deleted too).
+			if m.store[userID] == state {
+				delete(m.store, userID)
+				delete(m.timers, userID)
+			}
+		})
+	}
+
 	return nil
 }
 
@@ -45,5 +67,15 @@ func (m *MemoryStorage) Get(userID int64) (string, error) {
 func (m *MemoryStorage) Delete(userID int64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.stopTimer(userID)
 	delete(m.store, userID)
 }
+
+// stopTimer stops and clears any pending expiration timer for userID.
+// Callers must hold m.mu.
+func (m *MemoryStorage) stopTimer(userID int64) {
+	if timer, ok := m.timers[userID]; ok {
+		timer.Stop()
+		delete(m.timers, userID)
+	}
+}
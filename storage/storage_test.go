@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// TestMemoryStorageSetRaceDoesNotDropNewerValue is a regression test for the expiration
+// callback racing a concurrent Set for the same userID: the callback must not delete an entry
+// it wasn't scheduled for.
+func TestMemoryStorageSetRaceDoesNotDropNewerValue(t *testing.T) {
+	s := NewMemoryStorage()
+	userID := int64(1)
+
+	if err := s.Set(userID, "first", time.Millisecond); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	// Give the first entry's expiration timer a chance to fire right as the second Set below
+	// takes the lock, reproducing the window where a stale callback could wipe the new value.
+	time.Sleep(2 * time.Millisecond)
+
+	if err := s.Set(userID, "second", time.Hour); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	got, err := s.Get(userID)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if got != "second" {
+		t.Fatalf("expected the newer value to survive the race, got %q", got)
+	}
+}
@@ -0,0 +1,7 @@
+package wizard
+
+import "errors"
+
+// ErrRetry can be returned by a step's ValidateFunc to re-prompt the same step instead of
+// advancing the wizard
+var ErrRetry = errors.New("wizard: retry step")
@@ -0,0 +1,236 @@
+package wizard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nlypage/intele"
+	"github.com/nlypage/intele/collector"
+	"github.com/nlypage/intele/storage"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+const (
+	// BackUnique, SkipUnique and CancelUnique are the callback uniques the wizard wires
+	// through InputManager.CallbackHandler to drive step navigation.
+	BackUnique   = "wizard_back"
+	SkipUnique   = "wizard_skip"
+	CancelUnique = "wizard_cancel"
+)
+
+// BackBtn, SkipBtn and CancelBtn are ready-to-use inline buttons for step prompts. Embed
+// whichever are relevant in the markup your PromptFunc sends; Step/OptionalStep decide
+// which of them InputManager is actually listening for on that step.
+var (
+	BackBtn   = tele.Btn{Unique: BackUnique, Text: "← Back"}
+	SkipBtn   = tele.Btn{Unique: SkipUnique, Text: "Skip"}
+	CancelBtn = tele.Btn{Unique: CancelUnique, Text: "✕ Cancel"}
+)
+
+// PromptFunc sends the prompt for a step. Use mc instead of c.Bot() directly so the
+// message is auto-cleaned once the wizard finishes.
+type PromptFunc func(c tele.Context, mc *collector.MessageCollector, answers map[string]string) error
+
+// ValidateFunc validates a step's response and returns the value to store as its answer.
+// Return ErrRetry to re-prompt the same step.
+type ValidateFunc func(c tele.Context, resp intele.Response, answers map[string]string) (string, error)
+
+// Step is a single question in a Wizard flow
+type Step struct {
+	Name      string
+	Prompt    PromptFunc
+	Validate  ValidateFunc
+	Skippable bool
+}
+
+// Result is returned by Run once the wizard finishes or is canceled
+type Result struct {
+	// Answers maps each step's Name to its validated value
+	Answers map[string]string
+	// Canceled is true if the user canceled the wizard via CancelBtn
+	Canceled bool
+}
+
+// state is the JSON blob persisted through Storage between steps
+type state struct {
+	StepIndex int               `json:"step_index"`
+	Answers   map[string]string `json:"answers"`
+}
+
+// storageKey maps a Telegram user ID into a key space distinct from InputManager's own
+// "waiting_input" marker, which is keyed by the very same user ID on the very same
+// StateStorage whenever a persistent backend (e.g. storage.RedisStorage, itself keyed only
+// by userID) is shared between the two. Telegram user IDs are always positive, so flipping
+// the sign keeps wizard state from ever colliding with, and being overwritten by, Get's own
+// per-step marker.
+func storageKey(userID int64) int64 {
+	return -userID - 1
+}
+
+// Wizard is a multi-step input flow built on top of InputManager
+type Wizard struct {
+	im       *intele.InputManager
+	storage  storage.StateStorage
+	steps    []Step
+	onCancel func(c tele.Context) error
+	timeout  time.Duration
+}
+
+// New creates a new Wizard driven by the given InputManager
+//
+// NOTE:
+//   - If no storage is set via WithStorage, progress is kept in memory and won't survive a restart
+func New(im *intele.InputManager) *Wizard {
+	return &Wizard{
+		im:      im,
+		storage: storage.NewMemoryStorage(),
+	}
+}
+
+// WithStorage sets the storage used to persist step index and collected answers between
+// steps, so the wizard can resume after a restart if given a persistent backend
+// (e.g. storage.RedisStorage)
+func (w *Wizard) WithStorage(s storage.StateStorage) *Wizard {
+	w.storage = s
+	return w
+}
+
+// WithTimeout sets the timeout passed to InputManager.Get for each step (default: no timeout)
+func (w *Wizard) WithTimeout(d time.Duration) *Wizard {
+	w.timeout = d
+	return w
+}
+
+// Step adds a required question to the wizard
+func (w *Wizard) Step(name string, prompt PromptFunc, validate ValidateFunc) *Wizard {
+	w.steps = append(w.steps, Step{Name: name, Prompt: prompt, Validate: validate})
+	return w
+}
+
+// OptionalStep adds a question that the user can skip via SkipBtn
+func (w *Wizard) OptionalStep(name string, prompt PromptFunc, validate ValidateFunc) *Wizard {
+	w.steps = append(w.steps, Step{Name: name, Prompt: prompt, Validate: validate, Skippable: true})
+	return w
+}
+
+// OnCancel sets a callback invoked when the user cancels the wizard via CancelBtn
+func (w *Wizard) OnCancel(fn func(c tele.Context) error) *Wizard {
+	w.onCancel = fn
+	return w
+}
+
+// Run drives the wizard to completion, blocking until all steps are answered or the wizard
+// is canceled.
+//
+// NOTE:
+//   - This function is blocking, so make sure to call it in a separate goroutine
+//   - It returns whatever error InputManager.Get returns for the current step (e.g. ErrTimeout,
+//     ctx.Err()) if a step fails to complete
+func (w *Wizard) Run(ctx context.Context, c tele.Context) (Result, error) {
+	userID := c.Sender().ID
+	mc := collector.New()
+
+	index := 0
+	answers := make(map[string]string)
+	if raw, err := w.storage.Get(storageKey(userID)); err == nil && raw != "" {
+		var saved state
+		if err := json.Unmarshal([]byte(raw), &saved); err == nil {
+			index = saved.StepIndex
+			answers = saved.Answers
+		}
+	}
+
+	defer func() {
+		w.storage.Delete(storageKey(userID))
+		_ = mc.Clear(c, collector.ClearOptions{IgnoreErrors: true})
+	}()
+
+	for index < len(w.steps) {
+		step := w.steps[index]
+
+		if err := step.Prompt(c, mc, answers); err != nil {
+			return Result{}, err
+		}
+		w.persist(userID, index, answers)
+
+		// tele.Btn.CallbackUnique() has a pointer receiver, so CallbackEndpoint needs &BackBtn
+		// etc. rather than the values themselves.
+		endpoints := []tele.CallbackEndpoint{&CancelBtn}
+		if index > 0 {
+			endpoints = append(endpoints, &BackBtn)
+		}
+		if step.Skippable {
+			endpoints = append(endpoints, &SkipBtn)
+		}
+
+		resp, err := w.im.Get(ctx, userID, w.timeout, endpoints...)
+		if err != nil {
+			return Result{}, err
+		}
+		if resp.Canceled {
+			return w.cancel(c, answers)
+		}
+		if resp.Message != nil {
+			mc.Collect(resp.Message)
+		}
+
+		if resp.Callback != nil {
+			switch callbackUnique(resp.Callback) {
+			case CancelUnique:
+				return w.cancel(c, answers)
+			case BackUnique:
+				if index > 0 {
+					index--
+				}
+				continue
+			case SkipUnique:
+				index++
+				continue
+			}
+		}
+
+		value, err := step.Validate(c, resp, answers)
+		if err != nil {
+			if errors.Is(err, ErrRetry) {
+				continue
+			}
+			return Result{}, err
+		}
+
+		answers[step.Name] = value
+		index++
+	}
+
+	return Result{Answers: answers}, nil
+}
+
+func (w *Wizard) cancel(c tele.Context, answers map[string]string) (Result, error) {
+	if w.onCancel != nil {
+		if err := w.onCancel(c); err != nil {
+			return Result{}, err
+		}
+	}
+	return Result{Answers: answers, Canceled: true}, nil
+}
+
+// persist saves the current step index and answers so the wizard can resume after a restart
+func (w *Wizard) persist(userID int64, index int, answers map[string]string) {
+	data, err := json.Marshal(state{StepIndex: index, Answers: answers})
+	if err != nil {
+		return
+	}
+	_ = w.storage.Set(storageKey(userID), string(data), 0)
+}
+
+// callbackUnique mirrors InputManager.CallbackHandler's unique-extraction logic
+func callbackUnique(cb *tele.Callback) string {
+	if cb.Unique != "" {
+		return strings.TrimSpace(cb.Unique)
+	}
+	data := strings.Split(cb.Data, "|")
+	return strings.TrimSpace(data[0])
+}